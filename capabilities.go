@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"fmt"
+)
+
+// Features supported by a model
+type Capabilities struct {
+	HasHeat             bool // heating (hot & cool models)
+	HasHumidifier       bool // hume/humt and deep clean cycles
+	HasAngleControl     bool // osal/osau oscillation angles
+	HasAirflowDirection bool // fdir front/diffused airflow
+	HasDisplay          bool // LCD with bril brightness
+	HasPM25             bool // pm25/pm10/noxl instead of pact/vact
+	UsesTLS             bool // see ModelRequiresTLS
+}
+
+var modelCapabilities = map[string]Capabilities{
+	TypeModelN475:  {},
+	TypeModelN469:  {},
+	TypeModelN455:  {HasHeat: true},
+	TypeModelN438:  {HasAngleControl: true, HasAirflowDirection: true, HasDisplay: true, HasPM25: true},
+	TypeModelN520:  {HasAngleControl: true, HasAirflowDirection: true, HasDisplay: true, HasPM25: true},
+	TypeModelN527:  {HasHeat: true, HasAngleControl: true, HasAirflowDirection: true, HasDisplay: true, HasPM25: true},
+	TypeModelN358:  {HasHumidifier: true, HasAngleControl: true, HasAirflowDirection: true, HasDisplay: true, HasPM25: true},
+	TypeModelN358E: {HasHumidifier: true, HasAngleControl: true, HasAirflowDirection: true, HasDisplay: true, HasPM25: true},
+}
+
+// CapabilitiesForModel returns the features of the given model,
+// which is one of the TypeModel* constants
+func CapabilitiesForModel(model string) (*Capabilities, error) {
+	caps, found := modelCapabilities[model]
+	if found == false {
+		return nil, fmt.Errorf("Unknown model: %s", model)
+	}
+	caps.UsesTLS = ModelRequiresTLS(model)
+	return &caps, nil
+}
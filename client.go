@@ -11,77 +11,328 @@
 package dyslink
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/mitchellh/mapstructure"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func sendMessageCallback(ch chan<- *MessageCallback, msg mqtt.Message) {
-	var rv interface{}
+// sendMessageCallback decodes an incoming message and delivers
+// the result to the callback channel
+func (c *client) sendMessageCallback(msg mqtt.Message) {
+	command, rv, err := c.decodeMessage(msg)
+	cb := &MessageCallback{Error: err, Message: rv}
+	var rcv *receivedMessage
+	if err == nil && rv != nil {
+		rcv = &receivedMessage{command: command, message: rv}
+	}
+	if c.notifyWaiters(rcv) {
+		// the GetState caller may be the one draining CallbackChan:
+		// blocking here, even on unknown or bad messages, would
+		// keep paho from handing us its reply
+		if !c.send(cb, false) {
+			go c.deliver(cb)
+		}
+		return
+	}
+	c.deliver(cb)
+}
+
+// deliver sends cb to the callback channel, if any
+func (c *client) deliver(cb *MessageCallback) {
+	c.send(cb, true)
+}
+
+// send sends cb to the callback channel and returns false if it
+// would have blocked. The channel is owned by the user: a panic
+// (eg. because it was closed) is counted and the message dropped
+func (c *client) send(cb *MessageCallback, block bool) (sent bool) {
+	if c.opts.CallbackChan == nil {
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&c.panics, 1)
+			fmt.Printf("Warning: dropping message, callback channel panicked: %v\n", r)
+			sent = true
+		}
+	}()
+	if block {
+		c.opts.CallbackChan <- cb
+		return true
+	}
+	select {
+	case c.opts.CallbackChan <- cb:
+		return true
+	default:
+		return false
+	}
+}
+
+// decodeMessage parses the payload of msg. A panic while decoding a
+// bad payload is turned into an error so it can't take down the
+// receive loop
+func (c *client) decodeMessage(msg mqtt.Message) (command string, rv interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&c.panics, 1)
+			rv = nil
+			err = fmt.Errorf("Panic while decoding message on %s: %v", msg.Topic(), r)
+		}
+	}()
+
 	hdr := &commandHeader{}
-	err := json.Unmarshal(msg.Payload(), &hdr)
-	fmt.Printf("<< raw: %s\n", msg.Payload())
+	err = json.Unmarshal(msg.Payload(), &hdr)
+	command = hdr.Command
+	msgTime := MessageTime{ReceivedAt: time.Now()}
+	msgTime.Time, _ = time.Parse(time.RFC3339Nano, hdr.TimeString)
+	fmt.Printf("<< raw: %s\n", redactPayload(msg.Payload()))
 	if err == nil {
 		switch hdr.Command {
 		case MessageEnvSensorData:
 			envstate := &EnvironmentState{}
 			err = mapstructure.Decode(hdr.Data, &envstate)
+			envstate.MessageTime = msgTime
 			rv = envstate
 		case MessageCurrentState:
 			prodstate := &ProductState{}
 			err = mapstructure.Decode(hdr.ProductState, &prodstate)
+			prodstate.MessageTime = msgTime
 			rv = prodstate
+		case MessageCurrentFaults:
+			faults := &FaultsState{}
+			err = json.Unmarshal(msg.Payload(), &faults)
+			faults.MessageTime = msgTime
+			rv = faults
 		case MessageDeviceCredentials:
 			devcred := &DeviceCredentials{}
 			err = json.Unmarshal(msg.Payload(), &devcred)
 			rv = devcred
 		case MessageStateChange:
-			rv, err = parseStateChangePayload(hdr.ProductState)
+			var prodstate *ProductState
+			prodstate, err = parseStateChangePayload(hdr.ProductState)
+			if prodstate != nil {
+				prodstate.ModeReason = hdr.ModeReason
+				prodstate.MessageTime = msgTime
+				if c.opts.OverrideDetector != nil {
+					prodstate.ManualOverride = c.opts.OverrideDetector.Observe(prodstate)
+				}
+			}
+			rv = prodstate
 		default:
-			fmt.Printf("Warning: Unknown state update: %s, json=%s\n", hdr.Command, msg.Payload())
+			fmt.Printf("Warning: Unknown state update: %s, json=%s\n", hdr.Command, redactPayload(msg.Payload()))
 		}
 	}
-	if ch != nil {
-		ch <- &MessageCallback{Error: err, Message: rv}
-	}
+	return command, rv, err
 }
 
+// How long Identify keeps the toggled state
+const identifyDuration = 3 * time.Second
+
+// How often waitToken checks its context
+const tokenPollInterval = 100 * time.Millisecond
+
+// How long GetState waits for replies if the context has no deadline
+const DefaultGetStateTimeout = 10 * time.Second
+
 type Client interface {
 	Connect() error
+	ConnectContext(context.Context) error
 	Disconnect(uint)
 	WifiBootstrap(string, string) error
 	SetState(*FanState) error
+	SetStateContext(context.Context, *FanState) error
+	SetSleepTimer(int) error
+	SetSleepTimerContext(context.Context, int) error
+	SetOscillationAngle(int, int) error
+	SetOscillationAngleContext(context.Context, int, int) error
+	SetAirflowDirection(string) error
+	SetAirflowDirectionContext(context.Context, string) error
+	SetBrightness(string) error
+	SetBrightnessContext(context.Context, string) error
+	SetHumidify(string) error
+	SetHumidifyContext(context.Context, string) error
+	SetHumidityTarget(int) error
+	SetHumidityTargetContext(context.Context, int) error
 	RequestCurrentState() error
+	RequestCurrentStateContext(context.Context) error
+	RequestCurrentFaults() error
+	RequestCurrentFaultsContext(context.Context) error
+	GetState(context.Context) (*ProductState, *EnvironmentState, error)
+	Status() *ClientStatus
+	Capabilities() (*Capabilities, error)
+	Identify(context.Context) error
+	PanicCount() uint64
 }
 
 type client struct {
+	panics     uint64 // accessed atomically, keep first for 64bit alignment
+	queued     int32  // accessed atomically, state changes waiting for a slot
+	inFlight   int32  // accessed atomically, state changes being sent
+	slots      chan struct{}
 	MqttClient mqtt.Client
 	opts       *ClientOpts
+	mu         sync.Mutex
+	waiters    map[chan *receivedMessage]struct{}
+}
+
+// The connection state of a single ConnectContext call. paho's handlers
+// are bound to it, so a handshake abandoned by a cancelled connect
+// can't touch the state of a later one
+type session struct {
+	c          *client
+	connects   int32      // accessed atomically, number of OnConnect calls
+	subscribed chan error // result of the initial subscription
+	statusMu   sync.Mutex // orders ConnectionStatus events, guards the fields below
+	lostSent   bool       // the lost event was delivered, the reconnect event is due
+	regained   bool       // reconnected before the lost event was delivered
+	regainErr  error      // resubscribe error of an early reconnect
+}
+
+// A decoded message handed to internal waiters
+type receivedMessage struct {
+	command string
+	message interface{}
+}
+
+// A snapshot of the client status as returned by Status()
+type ClientStatus struct {
+	Connected bool
+	InFlight  int // state changes currently being sent
+	Queued    int // state changes waiting for an in-flight slot
 }
 
 // Returns a new client
 func NewClient(opts *ClientOpts) Client {
-	c := &client{opts: opts}
+	maxInFlight := opts.MaxInFlight
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	c := &client{opts: opts, slots: make(chan struct{}, maxInFlight)}
 	return c
 }
 
 // Establishes a new connection
 func (c *client) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext establishes a new connection, giving up
+// once ctx is done
+func (c *client) ConnectContext(ctx context.Context) error {
 	mqttOpts := mqtt.NewClientOptions().AddBroker(c.opts.DeviceAddress)
 	mqttOpts.SetUsername(c.opts.Username)
 	mqttOpts.SetPassword(c.opts.Password)
-	mqttOpts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) { sendMessageCallback(c.opts.CallbackChan, msg) })
+	if err := c.opts.checkTransport(); err != nil {
+		return err
+	}
+	if c.opts.TLSConfig != nil {
+		mqttOpts.SetTLSConfig(c.opts.TLSConfig)
+	}
+	mqttOpts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) { c.sendMessageCallback(msg) })
+	mqttOpts.SetAutoReconnect(c.opts.AutoReconnect)
+	if c.opts.MaxReconnectInterval > 0 {
+		mqttOpts.SetMaxReconnectInterval(c.opts.MaxReconnectInterval)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		mqttOpts.SetConnectTimeout(timeout) // zero would mean no timeout
+	}
+	s := c.newSession()
+	mqttOpts.SetOnConnectHandler(s.onConnect)
+	mqttOpts.SetConnectionLostHandler(s.onConnectionLost)
 	mqttClient := mqtt.NewClient(mqttOpts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		return token.Error()
+	if token := mqttClient.Connect(); waitToken(ctx, token) != nil {
+		if ctx.Err() == nil {
+			return token.Error()
+		}
+		// paho can't abort a running handshake: tear the session down
+		// once it completes, a late success must not stay connected
+		go func() {
+			token.Wait()
+			mqttClient.Disconnect(0)
+		}()
+		return ctx.Err()
+	}
+	// onConnect subscribes: wait for it, so replies to requests
+	// sent right after Connect returns can't be missed
+	select {
+	case err := <-s.subscribed:
+		if err != nil {
+			mqttClient.Disconnect(0)
+			return err
+		}
+	case <-ctx.Done():
+		mqttClient.Disconnect(0)
+		return ctx.Err()
 	}
-	mqttClient.Subscribe(c.getDeviceTopic("status/current"), 0, nil)
 	c.MqttClient = mqttClient
 	return nil
 }
 
+// Topics the device publishes to: CURRENT-FAULTS replies are
+// sent to status/faults, everything else to status/current
+var statusTopics = []string{"status/current", "status/faults"}
+
+// subscribe subscribes to the status topics of the device
+func (c *client) subscribe(mqttClient mqtt.Client) error {
+	for _, topic := range statusTopics {
+		if token := mqttClient.Subscribe(c.getDeviceTopic(topic), 0, nil); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+	}
+	return nil
+}
+
+// newSession returns the state for a new connection
+func (c *client) newSession() *session {
+	return &session{c: c, subscribed: make(chan error, 1)}
+}
+
+// onConnect is called by paho after each (re)connect. We use a clean
+// session, so subscriptions never survive a reconnect
+func (s *session) onConnect(mqttClient mqtt.Client) {
+	err := s.c.subscribe(mqttClient)
+	if atomic.AddInt32(&s.connects, 1) == 1 {
+		s.subscribed <- err // initial connect, not a reconnect
+		return
+	}
+
+	// paho runs this and onConnectionLost in separate goroutines:
+	// make sure the lost event always goes out first
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if s.lostSent {
+		s.lostSent = false
+		s.c.deliver(&MessageCallback{Error: err, Message: &ConnectionStatus{Connected: true}})
+	} else {
+		s.regained = true
+		s.regainErr = err
+	}
+}
+
+// onConnectionLost is called by paho if the connection drops. The
+// lost event is always delivered, paho only reconnects (and calls
+// onConnect again) if AutoReconnect is set
+func (s *session) onConnectionLost(mqttClient mqtt.Client, reason error) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	s.c.deliver(&MessageCallback{Error: reason, Message: &ConnectionStatus{Connected: false}})
+	if s.regained {
+		s.regained = false
+		s.c.deliver(&MessageCallback{Error: s.regainErr, Message: &ConnectionStatus{Connected: true}})
+	} else {
+		s.lostSent = true
+	}
+}
+
 // Disconnect disconnects the client
 // The quiesce parameter defines how long we are going
 // to wait for the connection tear down
@@ -105,31 +356,340 @@ func (c *client) WifiBootstrap(essid string, password string) error {
 
 // SetState sets the fan to given state
 func (c *client) SetState(state *FanState) error {
+	return c.SetStateContext(context.Background(), state)
+}
+
+// SetStateContext sets the fan to given state, giving up
+// once ctx is done
+func (c *client) SetStateContext(ctx context.Context, state *FanState) error {
+	// serialize state changes: interleaved STATE-SETs leave
+	// the device in an unpredictable state
+	atomic.AddInt32(&c.queued, 1)
+	select {
+	case c.slots <- struct{}{}:
+		atomic.AddInt32(&c.queued, -1)
+	case <-ctx.Done():
+		atomic.AddInt32(&c.queued, -1)
+		return ctx.Err()
+	}
+	atomic.AddInt32(&c.inFlight, 1)
+	defer func() {
+		atomic.AddInt32(&c.inFlight, -1)
+		<-c.slots
+	}()
+
 	cmd := &commandHeader{Command: "STATE-SET", Data: state}
-	return c.sendCommand(cmd)
+	if c.opts.OverrideDetector != nil {
+		c.opts.OverrideDetector.CommandSent()
+	}
+	return c.sendCommandContext(ctx, cmd)
+}
+
+// SetSleepTimer turns the fan off after the given number of
+// minutes, 0 disables the timer
+func (c *client) SetSleepTimer(minutes int) error {
+	return c.SetSleepTimerContext(context.Background(), minutes)
+}
+
+// SetSleepTimerContext is SetSleepTimer, giving up
+// once ctx is done
+func (c *client) SetSleepTimerContext(ctx context.Context, minutes int) error {
+	sltm, err := SleepTimerString(minutes)
+	if err != nil {
+		return err
+	}
+	return c.SetStateContext(ctx, &FanState{SleepTimer: sltm})
+}
+
+// SetOscillationAngle makes the fan oscillate between the
+// lower and upper angle (in degrees)
+func (c *client) SetOscillationAngle(lower int, upper int) error {
+	return c.SetOscillationAngleContext(context.Background(), lower, upper)
+}
+
+// SetOscillationAngleContext is SetOscillationAngle, giving up
+// once ctx is done
+func (c *client) SetOscillationAngleContext(ctx context.Context, lower int, upper int) error {
+	if caps, err := c.Capabilities(); err == nil && !caps.HasAngleControl {
+		return fmt.Errorf("Model %s does not support oscillation angles", c.opts.Model)
+	}
+	state, err := OscillationAngleState(lower, upper)
+	if err != nil {
+		return err
+	}
+	return c.SetStateContext(ctx, state)
+}
+
+// SetAirflowDirection switches between front (AirflowFront)
+// and diffused (AirflowBack) airflow
+func (c *client) SetAirflowDirection(direction string) error {
+	return c.SetAirflowDirectionContext(context.Background(), direction)
+}
+
+// SetAirflowDirectionContext is SetAirflowDirection, giving up
+// once ctx is done
+func (c *client) SetAirflowDirectionContext(ctx context.Context, direction string) error {
+	if direction != AirflowFront && direction != AirflowBack {
+		return fmt.Errorf("Invalid airflow direction %q", direction)
+	}
+	if caps, err := c.Capabilities(); err == nil && !caps.HasAirflowDirection {
+		return fmt.Errorf("Model %s does not support airflow direction", c.opts.Model)
+	}
+	return c.SetStateContext(ctx, &FanState{AirflowDirection: direction})
+}
+
+// SetBrightness sets the brightness of the display to
+// one of the Brightness* constants
+func (c *client) SetBrightness(level string) error {
+	return c.SetBrightnessContext(context.Background(), level)
+}
+
+// SetBrightnessContext is SetBrightness, giving up
+// once ctx is done
+func (c *client) SetBrightnessContext(ctx context.Context, level string) error {
+	switch level {
+	case BrightnessLow, BrightnessMedium, BrightnessHigh:
+	default:
+		return fmt.Errorf("Invalid brightness %q", level)
+	}
+	if caps, err := c.Capabilities(); err == nil && !caps.HasDisplay {
+		return fmt.Errorf("Model %s has no display", c.opts.Model)
+	}
+	return c.SetStateContext(ctx, &FanState{Brightness: level})
+}
+
+// SetHumidify switches humidification on (HumidifyOn) or off (HumidifyOff)
+func (c *client) SetHumidify(mode string) error {
+	return c.SetHumidifyContext(context.Background(), mode)
+}
+
+// SetHumidifyContext is SetHumidify, giving up
+// once ctx is done
+func (c *client) SetHumidifyContext(ctx context.Context, mode string) error {
+	if mode != HumidifyOn && mode != HumidifyOff {
+		return fmt.Errorf("Invalid humidify mode %q", mode)
+	}
+	if err := c.requireHumidifier(); err != nil {
+		return err
+	}
+	return c.SetStateContext(ctx, &FanState{HumidifyMode: mode})
+}
+
+// SetHumidityTarget sets the target humidity in percent. This
+// disables automatic humidity, which would ignore the target
+func (c *client) SetHumidityTarget(percent int) error {
+	return c.SetHumidityTargetContext(context.Background(), percent)
+}
+
+// SetHumidityTargetContext is SetHumidityTarget, giving up
+// once ctx is done
+func (c *client) SetHumidityTargetContext(ctx context.Context, percent int) error {
+	if err := c.requireHumidifier(); err != nil {
+		return err
+	}
+	humt, err := HumidityTargetString(percent)
+	if err != nil {
+		return err
+	}
+	return c.SetStateContext(ctx, &FanState{HumidityTarget: humt, HumidityAuto: HumidityAutoOff})
+}
+
+// requireHumidifier returns an error if the model is known
+// to have no humidifier
+func (c *client) requireHumidifier() error {
+	if caps, err := c.Capabilities(); err == nil && !caps.HasHumidifier {
+		return fmt.Errorf("Model %s has no humidifier", c.opts.Model)
+	}
+	return nil
 }
 
 // RequestCurrentState asks the connected device to return ENVIRONMENTAL-CURRENT-SENSORT-DATA
 // and CURRENT-STATE messages
 func (c *client) RequestCurrentState() error {
+	return c.RequestCurrentStateContext(context.Background())
+}
+
+// RequestCurrentStateContext is RequestCurrentState, giving up
+// once ctx is done
+func (c *client) RequestCurrentStateContext(ctx context.Context) error {
 	cmd := &commandHeader{Command: "REQUEST-CURRENT-STATE"}
-	return c.sendCommand(cmd)
+	return c.sendCommandContext(ctx, cmd)
+}
+
+// RequestCurrentFaults asks the connected device to return
+// a CURRENT-FAULTS message
+func (c *client) RequestCurrentFaults() error {
+	return c.RequestCurrentFaultsContext(context.Background())
+}
+
+// RequestCurrentFaultsContext is RequestCurrentFaults, giving up
+// once ctx is done
+func (c *client) RequestCurrentFaultsContext(ctx context.Context) error {
+	cmd := &commandHeader{Command: "REQUEST-CURRENT-FAULTS"}
+	return c.sendCommandContext(ctx, cmd)
+}
+
+// GetState requests the current state and waits for both the
+// CURRENT-STATE and ENVIRONMENTAL-CURRENT-SENSOR-DATA replies.
+// DefaultGetStateTimeout is applied if ctx has no deadline.
+// The replies are also sent to CallbackChan: while GetState waits,
+// messages which don't fit into CallbackChan right away are sent from
+// a separate goroutine, so their order is not guaranteed then
+func (c *client) GetState(ctx context.Context) (*ProductState, *EnvironmentState, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultGetStateTimeout)
+		defer cancel()
+	}
+
+	ch := c.addWaiter()
+	defer c.removeWaiter(ch)
+
+	if err := c.RequestCurrentStateContext(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	var prodstate *ProductState
+	var envstate *EnvironmentState
+	for prodstate == nil || envstate == nil {
+		select {
+		case rcv := <-ch:
+			switch rcv.command {
+			case MessageCurrentState:
+				prodstate = rcv.message.(*ProductState)
+			case MessageEnvSensorData:
+				envstate = rcv.message.(*EnvironmentState)
+			}
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	return prodstate, envstate, nil
+}
+
+// addWaiter registers a new channel receiving all decoded messages
+func (c *client) addWaiter() chan *receivedMessage {
+	ch := make(chan *receivedMessage, 8)
+	c.mu.Lock()
+	if c.waiters == nil {
+		c.waiters = make(map[chan *receivedMessage]struct{})
+	}
+	c.waiters[ch] = struct{}{}
+	c.mu.Unlock()
+	return ch
+}
+
+// removeWaiter unregisters a channel added by addWaiter
+func (c *client) removeWaiter(ch chan *receivedMessage) {
+	c.mu.Lock()
+	delete(c.waiters, ch)
+	c.mu.Unlock()
+}
+
+// notifyWaiters hands rcv (unless nil) to all registered waiters and
+// returns true if there were any. Slow waiters miss messages instead
+// of blocking the receive loop
+func (c *client) notifyWaiters(rcv *receivedMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rcv == nil {
+		return len(c.waiters) > 0
+	}
+	for ch := range c.waiters {
+		select {
+		case ch <- rcv:
+		default:
+		}
+	}
+	return len(c.waiters) > 0
+}
+
+// Identify makes the device visibly respond by toggling oscillation
+// for a few seconds. The current state is fetched first, its
+// oscillation setting is restored afterwards, even if ctx is done.
+// Note that this is only visible while the fan is running
+func (c *client) Identify(ctx context.Context) error {
+	current, _, err := c.GetState(ctx)
+	if err != nil {
+		return err
+	}
+	var toggled string
+	switch current.Oscillate {
+	case OscillateOn:
+		toggled = OscillateOff
+	case OscillateOff:
+		toggled = OscillateOn
+	default:
+		return fmt.Errorf("Unknown oscillation state %q, not identifying", current.Oscillate)
+	}
+	if err := c.SetStateContext(ctx, &FanState{Oscillate: toggled}); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(identifyDuration):
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	restoreCtx, cancel := context.WithTimeout(context.Background(), DefaultGetStateTimeout)
+	defer cancel()
+	if rerr := c.SetStateContext(restoreCtx, &FanState{Oscillate: current.Oscillate}); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// Status returns the connection state and the number of
+// pending state changes
+func (c *client) Status() *ClientStatus {
+	return &ClientStatus{
+		Connected: c.MqttClient != nil && c.MqttClient.IsConnected(),
+		InFlight:  int(atomic.LoadInt32(&c.inFlight)),
+		Queued:    int(atomic.LoadInt32(&c.queued)),
+	}
+}
+
+// Capabilities returns the features supported by the model
+// of the connected device
+func (c *client) Capabilities() (*Capabilities, error) {
+	return CapabilitiesForModel(c.opts.Model)
+}
+
+// PanicCount returns the number of panics recovered while
+// handling incoming messages or sending to CallbackChan
+func (c *client) PanicCount() uint64 {
+	return atomic.LoadUint64(&c.panics)
 }
 
 // sendCommand delivers given command to the device
 func (c *client) sendCommand(cmd *commandHeader) error {
+	return c.sendCommandContext(context.Background(), cmd)
+}
+
+// sendCommandContext delivers given command to the device, giving
+// up once ctx is done
+func (c *client) sendCommandContext(ctx context.Context, cmd *commandHeader) error {
 	cmd.TimeString = time.Now().UTC().Format(time.RFC3339Nano)
 
 	raw, err := json.Marshal(cmd)
-	fmt.Printf("SENDTO: %s\n", raw)
+	fmt.Printf("SENDTO: %s\n", redactPayload(raw))
 	if err == nil {
-		if token := c.MqttClient.Publish(c.getDeviceTopic("command"), 1, false, raw); token.Wait() && token.Error() != nil {
-			err = token.Error()
-		}
+		err = waitToken(ctx, c.MqttClient.Publish(c.getDeviceTopic("command"), 1, false, raw))
 	}
 	return err
 }
 
+// waitToken waits for token to complete or ctx to be done,
+// whichever happens first
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	for !token.WaitTimeout(tokenPollInterval) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return token.Error()
+}
+
 // getDeviceTopic returns the topic we are supposed to send for
 // this connection
 func (c *client) getDeviceTopic(command string) string {
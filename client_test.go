@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	unknownPayload      = `{"msg":"HELLO","time":"2019-01-01T10:00:00.000Z"}`
+	currentStatePayload = `{"msg":"CURRENT-STATE","time":"2019-01-01T10:00:00.000Z","product-state":{"fmod":"FAN","fnsp":"0004","oson":"ON"}}`
+	envPayload          = `{"msg":"ENVIRONMENTAL-CURRENT-SENSOR-DATA","time":"2019-01-01T10:00:00.000Z","data":{"tact":"2950","hact":"0040","pact":"0002","vact":"0001","sltm":"OFF"}}`
+	faultsPayload       = `{"msg":"CURRENT-FAULTS","time":"2019-01-01T10:00:00.000Z",
+		"product-errors":{"amf1":"OK","amf2":"FAIL"},"product-warnings":{"fltr":"FAIL"},
+		"module-errors":{"szme":"OK"},"module-warnings":{"srnk":"OK"}}`
+)
+
+// fakeToken is an already completed token
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+
+// fakeMessage is an incoming message
+type fakeMessage struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m *fakeMessage) Topic() string   { return m.topic }
+func (m *fakeMessage) Payload() []byte { return m.payload }
+
+// fakeMqtt records subscriptions and hands the name of every
+// published command to onPublish
+type fakeMqtt struct {
+	mqtt.Client
+	mu         sync.Mutex
+	subscribed []string
+	onPublish  func(command string)
+}
+
+func (f *fakeMqtt) IsConnected() bool { return true }
+
+func (f *fakeMqtt) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	hdr := &commandHeader{}
+	if err := json.Unmarshal(payload.([]byte), hdr); err != nil {
+		return &fakeToken{err: err}
+	}
+	if f.onPublish != nil {
+		f.onPublish(hdr.Command)
+	}
+	return &fakeToken{}
+}
+
+func (f *fakeMqtt) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	f.mu.Lock()
+	f.subscribed = append(f.subscribed, topic)
+	f.mu.Unlock()
+	return &fakeToken{}
+}
+
+// receive hands payload to c like paho's router does
+func receive(c *client, topic string, payload string) {
+	c.sendMessageCallback(&fakeMessage{topic: c.getDeviceTopic(topic), payload: []byte(payload)})
+}
+
+func TestGetStateUnknownMessage(t *testing.T) {
+	// unbuffered and only drained after GetState returns
+	callbacks := make(chan *MessageCallback)
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN475, CallbackChan: callbacks}).(*client)
+	c.MqttClient = &fakeMqtt{onPublish: func(command string) {
+		if command != "REQUEST-CURRENT-STATE" {
+			return
+		}
+		go func() {
+			for _, payload := range []string{unknownPayload, currentStatePayload, envPayload} {
+				receive(c, "status/current", payload)
+			}
+		}()
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	prodstate, envstate, err := c.GetState(ctx)
+	if err != nil {
+		t.Fatalf("GetState: %v", err)
+	}
+	if prodstate.FanSpeed != "0004" || envstate.Humidity != "0040" {
+		t.Errorf("got fnsp %q, hact %q", prodstate.FanSpeed, envstate.Humidity)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-callbacks:
+		case <-time.After(time.Second):
+			t.Fatalf("got %d of 3 callbacks", i)
+		}
+	}
+}
+
+func TestSubscribeFaults(t *testing.T) {
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN475}).(*client)
+	s := c.newSession()
+	fake := &fakeMqtt{}
+	s.onConnect(fake)
+	if err := <-s.subscribed; err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	want := []string{"475/NN2-EU-ABC1234A/status/current", "475/NN2-EU-ABC1234A/status/faults"}
+	if len(fake.subscribed) != len(want) || fake.subscribed[0] != want[0] || fake.subscribed[1] != want[1] {
+		t.Errorf("subscribed to %v, want %v", fake.subscribed, want)
+	}
+}
+
+func TestDecodeFaults(t *testing.T) {
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN475}).(*client)
+	msg := &fakeMessage{topic: c.getDeviceTopic("status/faults"), payload: []byte(faultsPayload)}
+	command, rv, err := c.decodeMessage(msg)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	faults, ok := rv.(*FaultsState)
+	if command != MessageCurrentFaults || !ok {
+		t.Fatalf("got %s %T, want a FaultsState", command, rv)
+	}
+	if faults.ProductErrors["amf1"] != FaultStatusOK || faults.ReceivedAt.IsZero() {
+		t.Errorf("unexpected faults %+v", faults)
+	}
+	active := faults.Active()
+	if len(active) != 2 || active[0] != "amf2" || active[1] != "fltr" {
+		t.Errorf("got active faults %v, want [amf2 fltr]", active)
+	}
+	if none := (&FaultsState{}).Active(); len(none) != 0 {
+		t.Errorf("got active faults %v for an empty report", none)
+	}
+}
+
+func TestConnectionLostWithoutAutoReconnect(t *testing.T) {
+	callbacks := make(chan *MessageCallback, 1)
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN475, CallbackChan: callbacks}).(*client)
+	reason := errors.New("connection reset")
+	c.newSession().onConnectionLost(&fakeMqtt{}, reason)
+	select {
+	case cb := <-callbacks:
+		if status, ok := cb.Message.(*ConnectionStatus); !ok || status.Connected || cb.Error != reason {
+			t.Errorf("got %+v (%v), want a lost ConnectionStatus", cb.Message, cb.Error)
+		}
+	default:
+		t.Fatal("lost connection was not reported")
+	}
+}
+
+func TestAbandonedSession(t *testing.T) {
+	callbacks := make(chan *MessageCallback, 4)
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN475, CallbackChan: callbacks}).(*client)
+	abandoned := c.newSession()
+	current := c.newSession()
+
+	// the handshake of a timed out connect completes after the retry
+	current.onConnect(&fakeMqtt{})
+	abandoned.onConnect(&fakeMqtt{})
+	if len(current.subscribed) != 1 || len(abandoned.subscribed) != 1 {
+		t.Fatalf("got %d and %d subscription results, want one each", len(current.subscribed), len(abandoned.subscribed))
+	}
+	if len(callbacks) != 0 {
+		t.Fatalf("got %d spurious ConnectionStatus events", len(callbacks))
+	}
+
+	// a real reconnect of the current session is still reported
+	current.onConnectionLost(&fakeMqtt{}, errors.New("connection reset"))
+	current.onConnect(&fakeMqtt{})
+	for _, connected := range []bool{false, true} {
+		cb := <-callbacks
+		if status, ok := cb.Message.(*ConnectionStatus); !ok || status.Connected != connected {
+			t.Errorf("got %+v, want ConnectionStatus{Connected: %v}", cb.Message, connected)
+		}
+	}
+}
+
+func TestSettersContext(t *testing.T) {
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN358}).(*client)
+	c.MqttClient = &fakeMqtt{}
+	c.slots <- struct{}{} // a hung STATE-SET holds the only slot
+
+	setters := map[string]func(context.Context) error{
+		"SetSleepTimer":       func(ctx context.Context) error { return c.SetSleepTimerContext(ctx, 60) },
+		"SetOscillationAngle": func(ctx context.Context) error { return c.SetOscillationAngleContext(ctx, 45, 135) },
+		"SetAirflowDirection": func(ctx context.Context) error { return c.SetAirflowDirectionContext(ctx, AirflowBack) },
+		"SetBrightness":       func(ctx context.Context) error { return c.SetBrightnessContext(ctx, BrightnessLow) },
+		"SetHumidify":         func(ctx context.Context) error { return c.SetHumidifyContext(ctx, HumidifyOn) },
+		"SetHumidityTarget":   func(ctx context.Context) error { return c.SetHumidityTargetContext(ctx, 50) },
+	}
+	for name, set := range setters {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if err := set(ctx); err != context.DeadlineExceeded {
+			t.Errorf("%s: got %v, want %v", name, err, context.DeadlineExceeded)
+		}
+		cancel()
+	}
+}
+
+func TestStateChangeManualOverride(t *testing.T) {
+	callbacks := make(chan *MessageCallback, 2)
+	detector := NewOverrideDetector(time.Hour)
+	c := NewClient(&ClientOpts{Username: "NN2-EU-ABC1234A", Model: TypeModelN475, CallbackChan: callbacks, OverrideDetector: detector}).(*client)
+
+	detector.CommandSent()
+	receive(c, "status/current", `{"msg":"STATE-CHANGE","time":"2019-01-01T10:00:00.000Z","mode-reason":"LAPP","product-state":{"fnsp":["0004","0006"]}}`)
+	receive(c, "status/current", `{"msg":"STATE-CHANGE","time":"2019-01-01T10:00:05.000Z","mode-reason":"PRC","product-state":{"fnsp":["0006","0002"]}}`)
+	for _, want := range []bool{false, true} {
+		cb := <-callbacks
+		state, ok := cb.Message.(*ProductState)
+		if !ok || state.ManualOverride != want {
+			t.Errorf("got %+v (%v), want ManualOverride %v", cb.Message, cb.Error, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+// Package cloud talks to the dyson account api to retrieve the
+// devices registered to an account and their local mqtt credentials
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jsouthworth/dyslink"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// The default api endpoint
+const DefaultEndpoint = "https://api.cp.dyson.com"
+
+type Client struct {
+	Endpoint   string       // api endpoint, DefaultEndpoint if empty
+	HTTPClient *http.Client // http.DefaultClient if nil
+	account    string
+	password   string
+}
+
+// A device registered to the account, as returned by the manifest
+type Device struct {
+	Serial           string `json:"Serial"`
+	Name             string `json:"Name"`
+	Version          string `json:"Version"` // firmware version
+	ProductType      string `json:"ProductType"`
+	Active           bool   `json:"Active"`
+	LocalCredentials string `json:"LocalCredentials"` // encrypted, see Credentials()
+}
+
+// Returns a new cloud client
+func NewClient() *Client {
+	return &Client{}
+}
+
+// Login authenticates against the account api. country is the
+// two letter code the account was registered in (eg. 'CH')
+func (c *Client) Login(ctx context.Context, email string, password string, country string) error {
+	body, err := json.Marshal(map[string]string{"Email": email, "Password": password})
+	if err != nil {
+		return err
+	}
+	path := "/v1/userregistration/authenticate?country=" + url.QueryEscape(country)
+	reply := &struct {
+		Account  string `json:"Account"`
+		Password string `json:"Password"`
+	}{}
+	if err := c.do(ctx, "POST", path, body, reply); err != nil {
+		return err
+	}
+	c.account = reply.Account
+	c.password = reply.Password
+	return nil
+}
+
+// Devices returns all devices registered to the account
+func (c *Client) Devices(ctx context.Context) ([]*Device, error) {
+	if c.account == "" {
+		return nil, fmt.Errorf("Not logged in")
+	}
+	devices := []*Device{}
+	err := c.do(ctx, "GET", "/v1/provisioningservice/manifest", nil, &devices)
+	return devices, err
+}
+
+// do sends a request to the api and decodes the json reply into v
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, v interface{}) error {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.account != "" {
+		req.SetBasicAuth(c.account, c.password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("Unexpected reply from %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ClientOpts returns options to connect to this device at the given
+// ip or hostname. The address uses ssl:// and port 8883 for the
+// TLS only models, see dyslink.DeviceAddress. DeviceAddress is left
+// empty if host is empty
+func (d *Device) ClientOpts(host string) (*dyslink.ClientOpts, error) {
+	username, password, err := d.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := &dyslink.ClientOpts{
+		Username: username,
+		Password: password,
+		Model:    d.ProductType,
+	}
+	if host != "" {
+		opts.DeviceAddress = dyslink.DeviceAddress(host, d.ProductType)
+	}
+	if dyslink.ModelRequiresTLS(d.ProductType) {
+		opts.TLSConfig = dyslink.DeviceTLSConfig()
+	}
+	return opts, nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package cloud
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// The key used by dyson to encrypt LocalCredentials: bytes 1 to 32
+var localCredentialsKey = func() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	return key
+}()
+
+// Credentials decrypts the local mqtt credentials of the device
+// and returns them as username and password
+func (d *Device) Credentials() (string, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(d.LocalCredentials)
+	if err != nil {
+		return "", "", err
+	}
+	if len(raw) == 0 || len(raw)%aes.BlockSize != 0 {
+		return "", "", fmt.Errorf("Unexpected credentials length: %d", len(raw))
+	}
+
+	block, err := aes.NewCipher(localCredentialsKey)
+	if err != nil {
+		return "", "", err
+	}
+	iv := make([]byte, aes.BlockSize) // all zero
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(raw, raw)
+
+	pad := int(raw[len(raw)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return "", "", fmt.Errorf("Invalid credentials padding")
+	}
+	raw = raw[:len(raw)-pad]
+
+	creds := &struct {
+		Serial   string `json:"serial"`
+		Password string `json:"apPasswordHash"`
+	}{}
+	if err := json.Unmarshal(raw, creds); err != nil {
+		return "", "", err
+	}
+	return creds.Serial, creds.Password, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package cloud
+
+import (
+	"testing"
+)
+
+// {"serial":"NN2-EU-ABC1234A","apPasswordHash":"c2VjcmV0"} encrypted with
+// openssl enc -aes-256-cbc, key bytes 1 to 32 and a zero iv
+const knownLocalCredentials = "OWfUlFHQFhy6EwFKHUDWxkex+47EqCDva+gGEXzPEsURebYW8nrnF7rwX7pu6fdkhAB4cB2jThAotyLTOgSwnA=="
+
+func TestCredentials(t *testing.T) {
+	d := &Device{LocalCredentials: knownLocalCredentials}
+	username, password, err := d.Credentials()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if username != "NN2-EU-ABC1234A" || password != "c2VjcmV0" {
+		t.Errorf("got %q/%q, want NN2-EU-ABC1234A/c2VjcmV0", username, password)
+	}
+}
+
+func TestCredentialsInvalid(t *testing.T) {
+	for _, raw := range []string{"", "not base64!", "AAAA"} {
+		d := &Device{LocalCredentials: raw}
+		if _, _, err := d.Credentials(); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestClientOpts(t *testing.T) {
+	d := &Device{LocalCredentials: knownLocalCredentials, ProductType: "438"}
+	opts, err := d.ClientOpts("192.0.2.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.DeviceAddress != "ssl://192.0.2.1:8883" || opts.TLSConfig == nil {
+		t.Errorf("TLS model got address %q, tls %v", opts.DeviceAddress, opts.TLSConfig != nil)
+	}
+	d.ProductType = "475"
+	if opts, _ = d.ClientOpts("192.0.2.1"); opts.DeviceAddress != "tcp://192.0.2.1:1883" || opts.TLSConfig != nil {
+		t.Errorf("plain model got address %q, tls %v", opts.DeviceAddress, opts.TLSConfig != nil)
+	}
+}
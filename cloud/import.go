@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jsouthworth/dyslink"
+	"io"
+)
+
+// ImportManifest reads a device manifest as returned by the account
+// api (see Devices), eg. saved from an earlier login, and returns
+// options with the decrypted credentials of every device. hosts maps
+// serials to an ip or hostname; DeviceAddress is left empty for
+// serials not in hosts.
+// libpurecool and opendyson keep no credentials on disk, they fetch
+// the manifest at login: use Client.Login and Client.Devices instead
+func ImportManifest(r io.Reader, hosts map[string]string) ([]*dyslink.ClientOpts, error) {
+	devices := []*Device{}
+	if err := json.NewDecoder(r).Decode(&devices); err != nil {
+		return nil, err
+	}
+
+	imported := []*dyslink.ClientOpts{}
+	for _, d := range devices {
+		opts, err := d.ClientOpts(hosts[d.Serial])
+		if err != nil {
+			return nil, fmt.Errorf("Device %s: %v", d.Serial, err)
+		}
+		imported = append(imported, opts)
+	}
+	return imported, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package cloud
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportManifest(t *testing.T) {
+	manifest := `[
+	  {"Serial": "NN2-EU-ABC1234A", "Name": "Bedroom", "ProductType": "475", "Active": true,
+	   "LocalCredentials": "` + knownLocalCredentials + `"},
+	  {"Serial": "A1B-EU-XYZ9876Z", "Name": "Office", "ProductType": "438", "Active": true,
+	   "LocalCredentials": "` + knownLocalCredentials + `"}
+	]`
+	hosts := map[string]string{"NN2-EU-ABC1234A": "192.0.2.1"}
+	imported, err := ImportManifest(strings.NewReader(manifest), hosts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("got %d devices, want 2", len(imported))
+	}
+	if imported[0].Password != "c2VjcmV0" || imported[0].DeviceAddress != "tcp://192.0.2.1:1883" {
+		t.Errorf("bedroom: got password %q, address %q", imported[0].Password, imported[0].DeviceAddress)
+	}
+	if imported[1].DeviceAddress != "" || imported[1].TLSConfig == nil {
+		t.Errorf("office: got address %q, tls %v", imported[1].DeviceAddress, imported[1].TLSConfig != nil)
+	}
+}
+
+func TestImportManifestInvalidCredentials(t *testing.T) {
+	manifest := `[{"Serial": "NN2-EU-ABC1234A", "ProductType": "475", "LocalCredentials": "AAAA"}]`
+	if _, err := ImportManifest(strings.NewReader(manifest), nil); err == nil {
+		t.Error("expected an error for undecryptable credentials")
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// CredentialsFromWifi derives the local mqtt credentials from the
+// wifi credentials printed on the sticker of the device.
+// The ssid looks like DYSON-NN2-EU-ABC1234A-475: the serial is used as
+// username and the model is the last part. The password is the
+// base64 encoded sha512 hash of the wifi password.
+// DeviceAddress of the returned options must be set by the caller
+func CredentialsFromWifi(ssid string, password string) (*ClientOpts, error) {
+	// DYSON, three serial parts and the model
+	parts := strings.Split(ssid, "-")
+	if len(parts) != 5 || strings.ToUpper(parts[0]) != "DYSON" {
+		return nil, fmt.Errorf("Unexpected ssid format: %s", ssid)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("Unexpected ssid format: %s", ssid)
+		}
+	}
+
+	hash := sha512.Sum512([]byte(password))
+	opts := &ClientOpts{
+		Username: strings.Join(parts[1:len(parts)-1], "-"),
+		Password: base64.StdEncoding.EncodeToString(hash[:]),
+		Model:    parts[len(parts)-1],
+	}
+	if ModelRequiresTLS(opts.Model) {
+		opts.TLSConfig = DeviceTLSConfig()
+	}
+	return opts, nil
+}
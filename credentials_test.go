@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"testing"
+)
+
+func TestCredentialsFromWifi(t *testing.T) {
+	tests := []struct {
+		ssid     string
+		password string
+		username string
+		hash     string
+		model    string
+		tls      bool
+		fail     bool
+	}{
+		{
+			ssid:     "DYSON-NN2-EU-ABC1234A-475",
+			password: "abcdefgh",
+			username: "NN2-EU-ABC1234A",
+			hash:     "o6jIG8l8JWABDXOJvIiqyXShBODiOBIgxuCExNzNHS0X1PhtsxwqhR3IDmaB10czxV3NA92W9gYs3aEqKRrmzg==",
+			model:    TypeModelN475,
+		},
+		{
+			ssid:     "DYSON-C2B-UK-MHA1234A-358E",
+			password: "password",
+			username: "C2B-UK-MHA1234A",
+			hash:     "sQnzu7wkTrgkQZF+0G1hi5AI3Qmzvv0bXgc5THBqi7mAsdd4Xll27ASbRt9fEyavWi6m0QP9B8lThf+rDKy8hg==",
+			model:    TypeModelN358E,
+		},
+		{
+			ssid:     "DYSON-A1B-EU-XYZ9876Z-438",
+			password: "password",
+			username: "A1B-EU-XYZ9876Z",
+			hash:     "sQnzu7wkTrgkQZF+0G1hi5AI3Qmzvv0bXgc5THBqi7mAsdd4Xll27ASbRt9fEyavWi6m0QP9B8lThf+rDKy8hg==",
+			model:    TypeModelN438,
+			tls:      true,
+		},
+		{ssid: "DYSON-x-475", fail: true},
+		{ssid: "DYSON-NN2--ABC1234A-475", fail: true},
+		{ssid: "HOME-NN2-EU-ABC1234A-475", fail: true},
+		{ssid: "", fail: true},
+	}
+
+	for _, tt := range tests {
+		opts, err := CredentialsFromWifi(tt.ssid, tt.password)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.ssid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.ssid, err)
+			continue
+		}
+		if opts.Username != tt.username || opts.Password != tt.hash || opts.Model != tt.model {
+			t.Errorf("%q: got %s/%s/%s", tt.ssid, opts.Username, opts.Password, opts.Model)
+		}
+		if (opts.TLSConfig != nil) != tt.tls {
+			t.Errorf("%q: tls config set: %v", tt.ssid, opts.TLSConfig != nil)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Config entry domain used by the ha-dyson integration
+const haDysonDomain = "dyson_local"
+
+// ImportHADyson reads the home assistant config entries file
+// (.storage/core.config_entries) and returns options for every device
+// configured with the ha-dyson (dyson_local) integration. DeviceAddress
+// is left empty for discovered devices which have no host stored
+func ImportHADyson(r io.Reader) ([]*ClientOpts, error) {
+	file := &struct {
+		Data struct {
+			Entries []struct {
+				Domain string `json:"domain"`
+				Data   struct {
+					Serial     string `json:"serial"`
+					Credential string `json:"credential"`
+					DeviceType string `json:"device_type"`
+					Host       string `json:"host"`
+				} `json:"data"`
+			} `json:"entries"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(r).Decode(file); err != nil {
+		return nil, err
+	}
+
+	imported := []*ClientOpts{}
+	for _, entry := range file.Data.Entries {
+		if entry.Domain != haDysonDomain {
+			continue
+		}
+		d := entry.Data
+		if d.Serial == "" || d.Credential == "" || d.DeviceType == "" {
+			return nil, fmt.Errorf("Incomplete %s entry for serial %q", haDysonDomain, d.Serial)
+		}
+		opts := &ClientOpts{Username: d.Serial, Password: d.Credential, Model: d.DeviceType}
+		if d.Host != "" {
+			opts.DeviceAddress = DeviceAddress(d.Host, d.DeviceType)
+		}
+		if ModelRequiresTLS(d.DeviceType) {
+			opts.TLSConfig = DeviceTLSConfig()
+		}
+		imported = append(imported, opts)
+	}
+	return imported, nil
+}
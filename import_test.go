@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"strings"
+	"testing"
+)
+
+const haConfigEntries = `{
+  "version": 1,
+  "key": "core.config_entries",
+  "data": {
+    "entries": [
+      {"domain": "sun", "data": {}},
+      {"domain": "dyson_local", "title": "Bedroom", "data": {
+        "serial": "NN2-EU-ABC1234A", "credential": "c2VjcmV0", "device_type": "475", "name": "Bedroom", "host": "192.0.2.1"}},
+      {"domain": "dyson_local", "title": "Office", "data": {
+        "serial": "A1B-EU-XYZ9876Z", "credential": "b3RoZXI=", "device_type": "438", "name": "Office"}}
+    ]
+  }
+}`
+
+func TestImportHADyson(t *testing.T) {
+	imported, err := ImportHADyson(strings.NewReader(haConfigEntries))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("got %d devices, want 2", len(imported))
+	}
+
+	bedroom := imported[0]
+	if bedroom.Username != "NN2-EU-ABC1234A" || bedroom.Password != "c2VjcmV0" || bedroom.Model != TypeModelN475 {
+		t.Errorf("bedroom: got %s/%s/%s", bedroom.Username, bedroom.Password, bedroom.Model)
+	}
+	if bedroom.DeviceAddress != "tcp://192.0.2.1:1883" || bedroom.TLSConfig != nil {
+		t.Errorf("bedroom: got address %q, tls %v", bedroom.DeviceAddress, bedroom.TLSConfig != nil)
+	}
+
+	office := imported[1]
+	if office.DeviceAddress != "" || office.TLSConfig == nil {
+		t.Errorf("office: got address %q, tls %v", office.DeviceAddress, office.TLSConfig != nil)
+	}
+}
+
+func TestImportHADysonIncomplete(t *testing.T) {
+	raw := `{"data": {"entries": [{"domain": "dyson_local", "data": {"serial": "NN2-EU-ABC1234A"}}]}}`
+	if _, err := ImportHADyson(strings.NewReader(raw)); err == nil {
+		t.Error("expected an error for an entry without credential")
+	}
+}
@@ -10,10 +10,30 @@
 
 package dyslink
 
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	TypeModelN475  = "475"  // pure link cool (non-desk)
+	TypeModelN469  = "469"  // pure link cool round/desk
+	TypeModelN455  = "455"  // pure hot & cool
+	TypeModelN438  = "438"  // pure cool tower (TP04), TLS only
+	TypeModelN520  = "520"  // pure cool desk (DP04), TLS only
+	TypeModelN527  = "527"  // pure hot & cool (HP04), TLS only
+	TypeModelN358  = "358"  // pure humidify+cool (PH01/PH02)
+	TypeModelN358E = "358E" // purifier humidify+cool (PH03)
+)
+
+// Ports of the local mqtt broker on the device
 const (
-	TypeModelN475 = "475" // pure link cool (non-desk)
-	TypeModelN469 = "469" // pure link cool round/desk
-	TypeModelN455 = "455" // pure hot & cool
+	DefaultPort    = 1883
+	DefaultTLSPort = 8883 // used by the TLS only models
 )
 
 type MessageCallback struct {
@@ -21,10 +41,75 @@ type MessageCallback struct {
 	Message interface{}
 }
 
+// Sent as Message of a MessageCallback if the connection was lost
+// (Error holds the reason) or, with AutoReconnect, re-established
+type ConnectionStatus struct {
+	Connected bool
+}
+
 type ClientOpts struct {
 	Username      string // The username to use for this connection
 	Password      string // The password to use for this connection
-	DeviceAddress string // The ip+port of the device in the tcp://IP:PORT format
+	DeviceAddress string // The ip+port of the device in the tcp://IP:PORT (or ssl://IP:PORT) format
 	Model         string // One of the TypeModel* constants
-	CallbackChan  chan<- *MessageCallback
+	// Receives all decoded messages. Keep it drained: a full channel
+	// blocks the receive loop (except while GetState is waiting)
+	CallbackChan chan<- *MessageCallback
+	// Optional: tracks manual state changes done by humans
+	OverrideDetector *OverrideDetector
+	// Optional: connect using TLS, required by the 438/520/527 models.
+	// DeviceAddress must use the ssl:// scheme, see DeviceAddress()
+	TLSConfig *tls.Config
+	// Reconnect with exponential backoff if the connection drops.
+	// Off by default, unlike in paho: without it a lost connection
+	// stays down after its ConnectionStatus was delivered
+	AutoReconnect bool
+	// Upper bound of the reconnect backoff, paho's default is used if zero
+	MaxReconnectInterval time.Duration
+	// Number of state changes which may be sent concurrently, defaults to 1
+	MaxInFlight int
+}
+
+// DeviceTLSConfig returns a tls config usable with the TLS only models.
+// The devices use self signed certificates, so we can't verify them
+func DeviceTLSConfig() *tls.Config {
+	return &tls.Config{InsecureSkipVerify: true}
+}
+
+// ModelRequiresTLS returns true if the given model only accepts
+// connections over TLS
+func ModelRequiresTLS(model string) bool {
+	switch model {
+	case TypeModelN438, TypeModelN520, TypeModelN527:
+		return true
+	}
+	return false
+}
+
+// DeviceAddress returns the address of a device with the given
+// ip (or hostname) in the format expected by ClientOpts.DeviceAddress
+func DeviceAddress(host string, model string) string {
+	if ModelRequiresTLS(model) {
+		return "ssl://" + net.JoinHostPort(host, strconv.Itoa(DefaultTLSPort))
+	}
+	return "tcp://" + net.JoinHostPort(host, strconv.Itoa(DefaultPort))
+}
+
+// checkTransport verifies that DeviceAddress and TLSConfig agree:
+// paho silently ignores the tls config for tcp:// addresses
+func (o *ClientOpts) checkTransport() error {
+	u, err := url.Parse(o.DeviceAddress)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("DeviceAddress must look like tcp://IP:PORT or ssl://IP:PORT, got %q", o.DeviceAddress)
+	}
+	secure := u.Scheme == "ssl" || u.Scheme == "tls" || u.Scheme == "tcps"
+	switch {
+	case ModelRequiresTLS(o.Model) && o.TLSConfig == nil:
+		return fmt.Errorf("Model %s requires TLS: set ClientOpts.TLSConfig", o.Model)
+	case ModelRequiresTLS(o.Model) && !secure:
+		return fmt.Errorf("Model %s requires TLS: use an ssl://IP:%d address, got %s", o.Model, DefaultTLSPort, o.DeviceAddress)
+	case o.TLSConfig != nil && !secure:
+		return fmt.Errorf("TLSConfig is set but %s is not an ssl:// address", o.DeviceAddress)
+	}
+	return nil
 }
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestCheckTransport(t *testing.T) {
+	tlsConfig := &tls.Config{}
+	tests := []struct {
+		name    string
+		model   string
+		address string
+		tls     *tls.Config
+		wantErr bool
+	}{
+		{"plain model", TypeModelN475, "tcp://192.0.2.1:1883", nil, false},
+		{"TLS model without config", TypeModelN438, "ssl://192.0.2.1:8883", nil, true},
+		{"TLS model with tcp address", TypeModelN438, "tcp://192.0.2.1:1883", tlsConfig, true},
+		{"TLS config with tcp address", TypeModelN475, "tcp://192.0.2.1:1883", tlsConfig, true},
+		{"TLS model with ssl address", TypeModelN438, "ssl://192.0.2.1:8883", tlsConfig, false},
+		{"TLS model with tls address", TypeModelN520, "tls://192.0.2.1:8883", tlsConfig, false},
+		{"TLS model with tcps address", TypeModelN527, "tcps://192.0.2.1:8883", tlsConfig, false},
+		{"TLS config with ssl address", TypeModelN475, "ssl://192.0.2.1:8883", tlsConfig, false},
+		{"TLS model without scheme", TypeModelN438, "192.0.2.1:8883", tlsConfig, true},
+		{"plain model without scheme", TypeModelN475, "192.0.2.1:1883", nil, true},
+		{"hostname without scheme", TypeModelN475, "fan.local:1883", nil, true},
+	}
+	for _, test := range tests {
+		opts := &ClientOpts{Model: test.model, DeviceAddress: test.address, TLSConfig: test.tls}
+		if err := opts.checkTransport(); (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestDeviceAddress(t *testing.T) {
+	tests := []struct {
+		host  string
+		model string
+		want  string
+	}{
+		{"192.0.2.1", TypeModelN475, "tcp://192.0.2.1:1883"},
+		{"192.0.2.1", TypeModelN438, "ssl://192.0.2.1:8883"},
+		{"fan.local", TypeModelN527, "ssl://fan.local:8883"},
+		{"2001:db8::1", TypeModelN455, "tcp://[2001:db8::1]:1883"},
+	}
+	for _, test := range tests {
+		if got := DeviceAddress(test.host, test.model); got != test.want {
+			t.Errorf("DeviceAddress(%q, %q) = %q, want %q", test.host, test.model, got, test.want)
+		}
+		opts := &ClientOpts{Model: test.model, DeviceAddress: DeviceAddress(test.host, test.model)}
+		if ModelRequiresTLS(test.model) {
+			opts.TLSConfig = DeviceTLSConfig()
+		}
+		if err := opts.checkTransport(); err != nil {
+			t.Errorf("DeviceAddress(%q, %q) is rejected: %v", test.host, test.model, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultAttributionWindow is the time after one of our own commands
+// during which a LAPP state change is considered to be caused by us
+const DefaultAttributionWindow = 5 * time.Second
+
+// OverrideDetector tracks state changes which were not initiated by
+// this client (remote control, app, buttons) so automations can back
+// off instead of instantly reverting a human's choice.
+// Set it as ClientOpts.OverrideDetector: overrides are flagged with
+// ProductState.ManualOverride as they arrive on CallbackChan, and
+// Respecting can be polled before sending a change.
+type OverrideDetector struct {
+	Window      time.Duration // how long to respect a manual change
+	Attribution time.Duration // see DefaultAttributionWindow, used if zero
+
+	mu         sync.Mutex
+	lastCmd    time.Time
+	lastManual time.Time
+}
+
+// NewOverrideDetector returns a detector respecting manual
+// changes for the given duration
+func NewOverrideDetector(window time.Duration) *OverrideDetector {
+	return &OverrideDetector{Window: window}
+}
+
+// CommandSent records that we just sent a state changing command
+func (d *OverrideDetector) CommandSent() {
+	d.mu.Lock()
+	d.lastCmd = time.Now()
+	d.mu.Unlock()
+}
+
+// Observe inspects a STATE-CHANGE and returns true if it
+// looks like a manual override
+func (d *OverrideDetector) Observe(state *ProductState) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	manual := false
+	switch state.ModeReason {
+	case ModeReasonRemoteControl, ModeReasonPhysicalUI, ModeReasonRemoteApp:
+		manual = true
+	case ModeReasonLocalApp:
+		// the official app also uses LAPP: only blame ourselves if we
+		// sent something recently
+		attribution := d.Attribution
+		if attribution == 0 {
+			attribution = DefaultAttributionWindow
+		}
+		manual = now.Sub(d.lastCmd) > attribution
+	}
+	if manual {
+		d.lastManual = now
+	}
+	return manual
+}
+
+// Respecting returns true while we are still inside of the
+// respect window of the last manual override
+func (d *OverrideDetector) Respecting() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.lastManual.IsZero() && time.Since(d.lastManual) < d.Window
+}
+
+// LastOverride returns the time of the last detected manual override
+func (d *OverrideDetector) LastOverride() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lastManual
+}
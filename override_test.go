@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOverrideAttribution(t *testing.T) {
+	tests := []struct {
+		name       string
+		reason     string
+		sinceCmd   time.Duration // zero if we never sent a command
+		wantManual bool
+	}{
+		{"LAPP inside the attribution window", ModeReasonLocalApp, time.Second, false},
+		{"LAPP outside the attribution window", ModeReasonLocalApp, time.Minute, true},
+		{"LAPP without own commands", ModeReasonLocalApp, 0, true},
+		{"remote control", ModeReasonRemoteControl, time.Second, true},
+		{"buttons", ModeReasonPhysicalUI, time.Second, true},
+		{"cloud app", ModeReasonRemoteApp, time.Second, true},
+		{"schedule", ModeReasonSchedule, time.Minute, false},
+		{"no reason", "", time.Minute, false},
+	}
+	for _, test := range tests {
+		d := NewOverrideDetector(time.Hour)
+		if test.sinceCmd != 0 {
+			d.lastCmd = time.Now().Add(-test.sinceCmd)
+		}
+		if got := d.Observe(&ProductState{ModeReason: test.reason}); got != test.wantManual {
+			t.Errorf("%s: Observe = %v, want %v", test.name, got, test.wantManual)
+		}
+		if d.Respecting() != test.wantManual || d.LastOverride().IsZero() == test.wantManual {
+			t.Errorf("%s: Respecting = %v, LastOverride = %v", test.name, d.Respecting(), d.LastOverride())
+		}
+	}
+}
+
+func TestOverrideCustomAttribution(t *testing.T) {
+	d := &OverrideDetector{Window: time.Hour, Attribution: 10 * time.Second}
+	d.lastCmd = time.Now().Add(-8 * time.Second)
+	if d.Observe(&ProductState{ModeReason: ModeReasonLocalApp}) {
+		t.Error("LAPP 8s after a command was considered manual")
+	}
+	d.CommandSent()
+	if d.Observe(&ProductState{ModeReason: ModeReasonLocalApp}) {
+		t.Error("LAPP right after CommandSent was considered manual")
+	}
+}
+
+func TestOverrideWindowExpiry(t *testing.T) {
+	d := NewOverrideDetector(time.Minute)
+	d.Observe(&ProductState{ModeReason: ModeReasonRemoteControl})
+	if !d.Respecting() {
+		t.Fatal("not respecting a fresh override")
+	}
+	d.lastManual = time.Now().Add(-2 * time.Minute)
+	if d.Respecting() {
+		t.Error("still respecting an override older than the window")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Keys whose values must never show up in logs
+var sensitiveKeys = map[string]bool{
+	"password":       true, // wifi password during bootstrap
+	"appasswordhash": true, // local mqtt password in DEVICE-CREDENTIALS
+}
+
+// redactPayload returns a copy of the json payload raw with all
+// sensitive values replaced. Payloads which can't be parsed are
+// replaced entirely, as we can't tell what they contain
+func redactPayload(raw []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return []byte(redactedValue)
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return []byte(redactedValue)
+	}
+	return out
+}
+
+// redactValue walks v and replaces values of sensitive keys
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, val := range t {
+			if sensitiveKeys[strings.ToLower(key)] {
+				t[key] = redactedValue
+			} else {
+				t[key] = redactValue(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+	}
+	return v
+}
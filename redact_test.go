@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactPayload(t *testing.T) {
+	joinNetwork, _ := json.Marshal(&commandHeader{Command: MessageJoinNetwork, WifiSsid: "home", WifiPassword: "wifi-secret", RequestId: "0123456789ABCDEF"})
+
+	tests := []struct {
+		name    string
+		payload string
+		secrets []string
+		keep    []string
+	}{
+		{
+			name:    "join network",
+			payload: string(joinNetwork),
+			secrets: []string{"wifi-secret"},
+			keep:    []string{MessageJoinNetwork, "home"},
+		},
+		{
+			name:    "device credentials",
+			payload: `{"msg":"DEVICE-CREDENTIALS","serialNumber":"NN2-EU-ABC1234A","apPasswordHash":"hash-secret"}`,
+			secrets: []string{"hash-secret"},
+			keep:    []string{"NN2-EU-ABC1234A"},
+		},
+		{
+			name:    "nested and arrays",
+			payload: `{"msg":"X","data":{"list":[{"Password":"nested-secret"},"plain"]}}`,
+			secrets: []string{"nested-secret"},
+			keep:    []string{"plain"},
+		},
+		{
+			name:    "not json",
+			payload: `password=raw-secret`,
+			secrets: []string{"raw-secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		out := string(redactPayload([]byte(tt.payload)))
+		for _, secret := range tt.secrets {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s: %q leaked in %s", tt.name, secret, out)
+			}
+		}
+		for _, keep := range tt.keep {
+			if !strings.Contains(out, keep) {
+				t.Errorf("%s: %q missing in %s", tt.name, keep, out)
+			}
+		}
+		if !strings.Contains(out, redactedValue) {
+			t.Errorf("%s: no redaction marker in %s", tt.name, out)
+		}
+	}
+}
@@ -10,6 +10,11 @@
 
 package dyslink
 
+import (
+	"sort"
+	"time"
+)
+
 // Messages related to fan states
 const (
 	MessageCurrentState         = "CURRENT-STATE"                     // incoming state data
@@ -19,6 +24,22 @@ const (
 	MessageAuthoriseUserRequest = "AUTHORISE-USER-REQUEST"
 	MessageCloseAccessPoint     = "CLOSE-ACCESS-POINT"
 	MessageDeviceCredentials    = "DEVICE-CREDENTIALS"
+	MessageCurrentFaults        = "CURRENT-FAULTS" // incoming fault report
+)
+
+// Status of a single fault code in a FaultsState
+const (
+	FaultStatusOK   = "OK"
+	FaultStatusFail = "FAIL"
+)
+
+// Reasons reported by the device for a state change (mode-reason)
+const (
+	ModeReasonLocalApp      = "LAPP" // local app or library (this includes us)
+	ModeReasonRemoteApp     = "RAPP" // app via the dyson cloud
+	ModeReasonRemoteControl = "PRC"  // physical remote control
+	ModeReasonPhysicalUI    = "PUI"  // buttons on the device itself
+	ModeReasonSchedule      = "LSCH" // on-device schedule
 )
 
 // States of fan modules
@@ -33,6 +54,39 @@ const (
 	QualityLow    = "0001"
 	QualityNormal = "0003"
 	QualityHigh   = "0004"
+	SleepTimerOff = "OFF"
+	AirflowFront  = "ON"  // 2018+ models: blow air to the front
+	AirflowBack   = "OFF" // 2018+ models: diffused (backward) airflow
+)
+
+// Display brightness (bril) of models with an LCD
+const (
+	BrightnessLow    = "0001"
+	BrightnessMedium = "0002"
+	BrightnessHigh   = "0003"
+)
+
+// Longest sleep timer accepted by the device, in minutes
+const MaxSleepTimerMinutes = 540
+
+// States of humidifier modules (358/358E)
+const (
+	HumidifyOn          = "HUMD"
+	HumidifyOff         = "OFF"
+	HumidityAutoOn      = "ON"
+	HumidityAutoOff     = "OFF"
+	WaterHardnessSoft   = "2025"
+	WaterHardnessMedium = "1350"
+	WaterHardnessHard   = "0675"
+	MinHumidityTarget   = 30
+	MaxHumidityTarget   = 70
+)
+
+// Oscillation angle limits of the 438/527 models, in degrees
+const (
+	AnglePresetCustom   = "CUST"
+	MinOscillationAngle = 5
+	MaxOscillationAngle = 355
 )
 
 // The command-json sent to the device
@@ -60,6 +114,15 @@ type FanState struct {
 	ResetFilter       string `json:"rstf,omitempty"` // resets lifetime of filter?
 	QualityTarget     string `json:"qtar,omitempty"` // the air-target in auto-mode
 	NightMode         string `json:"nmod,omitempty"`
+	Brightness        string `json:"bril,omitempty"` // display brightness on models with an LCD
+	HumidifyMode      string `json:"hume,omitempty"` // humidifiers only
+	HumidityTarget    string `json:"humt,omitempty"` // target humidity in percent
+	HumidityAuto      string `json:"haut,omitempty"` // let the device pick the target
+	WaterHardness     string `json:"wath,omitempty"`
+	AngleLow          string `json:"osal,omitempty"` // lower oscillation angle in degrees
+	AngleHigh         string `json:"osau,omitempty"` // upper oscillation angle in degrees
+	AnglePreset       string `json:"ancp,omitempty"`
+	AirflowDirection  string `json:"fdir,omitempty"` // one of the Airflow* constants
 }
 
 // A product status message
@@ -74,9 +137,23 @@ type ProductState struct {
 	ResetFilter       string `mapstructure:"rstf"` // resets lifetime of filter?
 	QualityTarget     string `mapstructure:"qtar"`
 	NightMode         string `mapstructure:"nmod"`
+	Brightness        string `mapstructure:"bril"`
 	FilterLife        string `mapstructure:"filf"`
 	UnknownErcd       string `mapstructure:"ercd"`
 	UnknownWacd       string `mapstructure:"wacd"`
+	HumidifyMode      string `mapstructure:"hume"`
+	HumidityTarget    string `mapstructure:"humt"`
+	HumidityAuto      string `mapstructure:"haut"`
+	WaterHardness     string `mapstructure:"wath"`
+	CleanRemaining    string `mapstructure:"cdrr"` // minutes left of a deep clean cycle
+	CleanDue          string `mapstructure:"cltr"` // hours until the next deep clean
+	AngleLow          string `mapstructure:"osal"`
+	AngleHigh         string `mapstructure:"osau"`
+	AnglePreset       string `mapstructure:"ancp"`
+	AirflowDirection  string `mapstructure:"fdir"`
+	ModeReason        string `mapstructure:"mode-reason"` // only set for STATE-CHANGE messages
+	ManualOverride    bool   `mapstructure:"-"`           // STATE-CHANGE judged manual by ClientOpts.OverrideDetector
+	MessageTime       `mapstructure:"-"`
 }
 
 // The current environment data as reported by the device
@@ -86,6 +163,34 @@ type EnvironmentState struct {
 	Particle    string `mapstructure:"pact"`
 	UnknownVact string `mapstructure:"vact"`
 	SleepTimer  string `mapstructure:"sltm"`
+	// Sent by the 2018+ models (438/520/527) instead of pact/vact
+	PM25        string `mapstructure:"pm25"` // PM2.5 in µg/m³
+	PM10        string `mapstructure:"pm10"` // PM10 in µg/m³
+	NO2         string `mapstructure:"noxl"` // nitrogen dioxide index
+	PM25Raw     string `mapstructure:"p25r"`
+	PM10Raw     string `mapstructure:"p10r"`
+	MessageTime `mapstructure:"-"`
+}
+
+// Timestamps of a received message
+type MessageTime struct {
+	Time       time.Time // as reported by the device, its clock is often wrong
+	ReceivedAt time.Time // local receive time
+}
+
+// Age returns how old the message is. This uses the local receive time
+// (and its monotonic clock reading) as device clocks can't be trusted
+func (m MessageTime) Age() time.Duration {
+	return time.Since(m.ReceivedAt)
+}
+
+// ClockSkew returns how far the device clock is ahead of ours
+// (including the delivery delay), zero if the device sent no time
+func (m MessageTime) ClockSkew() time.Duration {
+	if m.Time.IsZero() {
+		return 0
+	}
+	return m.Time.Sub(m.ReceivedAt)
 }
 
 // Reply for a credentials request (note: this is sent in a commandHeader)
@@ -93,3 +198,27 @@ type DeviceCredentials struct {
 	SerialNumber string `json:"serialNumber"`
 	Password     string `json:"apPasswordHash"`
 }
+
+// Faults reported by the device. Each map goes from the fault code
+// to its FaultStatus* value
+type FaultsState struct {
+	ProductErrors   map[string]string `json:"product-errors"`
+	ProductWarnings map[string]string `json:"product-warnings"`
+	ModuleErrors    map[string]string `json:"module-errors"`
+	ModuleWarnings  map[string]string `json:"module-warnings"`
+	MessageTime     `json:"-"`
+}
+
+// Active returns the codes of all faults which are not OK
+func (f *FaultsState) Active() []string {
+	active := []string{}
+	for _, m := range []map[string]string{f.ProductErrors, f.ProductWarnings, f.ModuleErrors, f.ModuleWarnings} {
+		for code, status := range m {
+			if status != FaultStatusOK {
+				active = append(active, code)
+			}
+		}
+	}
+	sort.Strings(active)
+	return active
+}
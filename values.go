@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrValueUnavailable is returned by the typed accessors if the device
+// did not report a value (eg. 'OFF' or 'INIT' while sensors warm up)
+var ErrValueUnavailable = errors.New("Value not available")
+
+// Lifetime of a new filter in hours, as counted down by filf
+const filterLifetimeHours = 4300
+
+// A temperature, stored in Kelvin (the device reports deciKelvin)
+type Temperature float64
+
+// Kelvin returns the temperature in Kelvin
+func (t Temperature) Kelvin() float64 {
+	return float64(t)
+}
+
+// Celsius returns the temperature in degrees Celsius
+func (t Temperature) Celsius() float64 {
+	return float64(t) - 273.15
+}
+
+// Fahrenheit returns the temperature in degrees Fahrenheit
+func (t Temperature) Fahrenheit() float64 {
+	return t.Celsius()*9/5 + 32
+}
+
+func (t Temperature) String() string {
+	return fmt.Sprintf("%.1f°C", t.Celsius())
+}
+
+// A temperature reading. Valid is false if the sensor did not
+// report a value, eg. while warming up or in standby. Use Age()
+// of the embedded MessageTime to tell how fresh it is
+type Temp struct {
+	Value Temperature
+	Valid bool
+	MessageTime
+}
+
+// A relative humidity reading in percent
+type RelHumidity struct {
+	Percent int
+	Valid   bool
+	MessageTime
+}
+
+// A particle reading (µg/m³ for PM2.5 and PM10)
+type PMConcentration struct {
+	Value int
+	Valid bool
+	MessageTime
+}
+
+// parseInt parses a zero padded protocol integer such as '0042'
+func parseInt(raw string) (int, error) {
+	switch raw {
+	case "", "OFF", "INIT", "NONE":
+		return 0, ErrValueUnavailable
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("Unexpected numeric value %q", raw)
+	}
+	return v, nil
+}
+
+// parseBool parses an ON/OFF protocol value
+func parseBool(raw string) (bool, error) {
+	switch raw {
+	case "ON":
+		return true, nil
+	case "OFF":
+		return false, nil
+	case "":
+		return false, ErrValueUnavailable
+	}
+	return false, fmt.Errorf("Unexpected boolean value %q", raw)
+}
+
+// parseMinutes parses a timer value, where OFF means zero
+func parseMinutes(raw string) (int, error) {
+	if raw == "OFF" {
+		return 0, nil
+	}
+	return parseInt(raw)
+}
+
+// SleepTimerString returns the protocol value for a sleep timer of
+// the given minutes, 0 disables the timer
+func SleepTimerString(minutes int) (string, error) {
+	if minutes == 0 {
+		return SleepTimerOff, nil
+	}
+	if minutes < 0 || minutes > MaxSleepTimerMinutes {
+		return "", fmt.Errorf("Sleep timer must be between 0 and %d minutes, got %d", MaxSleepTimerMinutes, minutes)
+	}
+	return fmt.Sprintf("%04d", minutes), nil
+}
+
+// HumidityTargetString returns the protocol value for a
+// humidifier target of the given percent
+func HumidityTargetString(percent int) (string, error) {
+	if percent < MinHumidityTarget || percent > MaxHumidityTarget {
+		return "", fmt.Errorf("Humidity target must be between %d and %d percent, got %d", MinHumidityTarget, MaxHumidityTarget, percent)
+	}
+	return fmt.Sprintf("%04d", percent), nil
+}
+
+// OscillationAngleState returns a state which oscillates between
+// the given angles (in degrees)
+func OscillationAngleState(lower int, upper int) (*FanState, error) {
+	if lower < MinOscillationAngle || upper > MaxOscillationAngle || lower >= upper {
+		return nil, fmt.Errorf("Oscillation angles must satisfy %d <= lower < upper <= %d, got %d and %d", MinOscillationAngle, MaxOscillationAngle, lower, upper)
+	}
+	state := &FanState{
+		Oscillate:   OscillateOn,
+		AngleLow:    fmt.Sprintf("%04d", lower),
+		AngleHigh:   fmt.Sprintf("%04d", upper),
+		AnglePreset: AnglePresetCustom,
+	}
+	return state, nil
+}
+
+// TemperatureValue returns the parsed temperature
+func (e *EnvironmentState) TemperatureValue() (Temperature, error) {
+	v, err := parseInt(e.Temperature)
+	return Temperature(float64(v) / 10), err
+}
+
+// HumidityValue returns the relative humidity in percent
+func (e *EnvironmentState) HumidityValue() (int, error) {
+	return parseInt(e.Humidity)
+}
+
+// ParticleValue returns the particle (dust) level
+func (e *EnvironmentState) ParticleValue() (int, error) {
+	return parseInt(e.Particle)
+}
+
+// TemperatureReading returns the temperature reading
+func (e *EnvironmentState) TemperatureReading() Temp {
+	v, err := e.TemperatureValue()
+	return Temp{Value: v, Valid: err == nil, MessageTime: e.MessageTime}
+}
+
+// HumidityReading returns the humidity reading
+func (e *EnvironmentState) HumidityReading() RelHumidity {
+	v, err := e.HumidityValue()
+	return RelHumidity{Percent: v, Valid: err == nil, MessageTime: e.MessageTime}
+}
+
+// ParticleReading returns the particle (dust) reading
+func (e *EnvironmentState) ParticleReading() PMConcentration {
+	v, err := e.ParticleValue()
+	return PMConcentration{Value: v, Valid: err == nil, MessageTime: e.MessageTime}
+}
+
+// PM25Reading returns the PM2.5 reading of the 2018+ models
+func (e *EnvironmentState) PM25Reading() PMConcentration {
+	v, err := parseInt(e.PM25)
+	return PMConcentration{Value: v, Valid: err == nil, MessageTime: e.MessageTime}
+}
+
+// PM10Reading returns the PM10 reading of the 2018+ models
+func (e *EnvironmentState) PM10Reading() PMConcentration {
+	v, err := parseInt(e.PM10)
+	return PMConcentration{Value: v, Valid: err == nil, MessageTime: e.MessageTime}
+}
+
+// NO2Value returns the nitrogen dioxide index of the 2018+ models
+func (e *EnvironmentState) NO2Value() (int, error) {
+	return parseInt(e.NO2)
+}
+
+// SleepTimerValue returns the remaining sleep timer in minutes, 0 if disabled
+func (e *EnvironmentState) SleepTimerValue() (int, error) {
+	return parseMinutes(e.SleepTimer)
+}
+
+// FanSpeedValue returns the fan speed (1-10), 0 means AUTO
+func (p *ProductState) FanSpeedValue() (int, error) {
+	if p.FanSpeed == FanModeAuto {
+		return 0, nil
+	}
+	return parseInt(p.FanSpeed)
+}
+
+// FilterLifeHours returns the remaining filter lifetime in hours
+func (p *ProductState) FilterLifeHours() (int, error) {
+	return parseInt(p.FilterLife)
+}
+
+// FilterLifePercent returns the remaining filter lifetime in percent.
+// Some filters report more than filterLifetimeHours, this is capped at 100
+func (p *ProductState) FilterLifePercent() (int, error) {
+	v, err := p.FilterLifeHours()
+	if v > filterLifetimeHours {
+		v = filterLifetimeHours
+	}
+	return v * 100 / filterLifetimeHours, err
+}
+
+// SleepTimerValue returns the remaining sleep timer in minutes, 0 if disabled
+func (p *ProductState) SleepTimerValue() (int, error) {
+	return parseMinutes(p.SleepTimer)
+}
+
+// IsOscillating returns true if oscillation is enabled
+func (p *ProductState) IsOscillating() (bool, error) {
+	return parseBool(p.Oscillate)
+}
+
+// IsNightMode returns true if night mode is enabled
+func (p *ProductState) IsNightMode() (bool, error) {
+	return parseBool(p.NightMode)
+}
+
+// IsStandbyMonitoring returns true if the device captures environment
+// data while the fan is off
+func (p *ProductState) IsStandbyMonitoring() (bool, error) {
+	return parseBool(p.StandbyMonitoring)
+}
+
+// IsHumidifying returns true if humidification is enabled
+func (p *ProductState) IsHumidifying() (bool, error) {
+	switch p.HumidifyMode {
+	case HumidifyOn:
+		return true, nil
+	case HumidifyOff:
+		return false, nil
+	case "":
+		return false, ErrValueUnavailable
+	}
+	return false, fmt.Errorf("Unexpected humidify mode %q", p.HumidifyMode)
+}
+
+// HumidityTargetValue returns the humidifier target in percent
+func (p *ProductState) HumidityTargetValue() (int, error) {
+	return parseInt(p.HumidityTarget)
+}
+
+// OscillationAngles returns the lower and upper oscillation angle in degrees
+func (p *ProductState) OscillationAngles() (int, int, error) {
+	lower, err := parseInt(p.AngleLow)
+	if err != nil {
+		return 0, 0, err
+	}
+	upper, err := parseInt(p.AngleHigh)
+	return lower, upper, err
+}
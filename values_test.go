@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2016 Adrian Ulrich
+ *
+ * All rights reserved. This program and the accompanying materials
+ * are made available under the terms of the Eclipse Public License v1.0
+ * which accompanies this distribution, and is available at
+ * http://www.eclipse.org/legal/epl-v10.html
+ *
+ */
+
+package dyslink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadingsUseReceiveTime(t *testing.T) {
+	received := time.Now().Add(-time.Minute)
+	env := &EnvironmentState{
+		Temperature: "2950",
+		Humidity:    "INIT",
+		PM25:        "0012",
+		// the device clock is a year off
+		MessageTime: MessageTime{Time: received.AddDate(-1, 0, 0), ReceivedAt: received},
+	}
+
+	temp := env.TemperatureReading()
+	if !temp.Valid || temp.ReceivedAt != received {
+		t.Errorf("got %+v", temp)
+	}
+	if age := temp.Age(); age < time.Minute || age > 2*time.Minute {
+		t.Errorf("got age %v, want about a minute", age)
+	}
+	if hum := env.HumidityReading(); hum.Valid || hum.ReceivedAt != received {
+		t.Errorf("got %+v, want an invalid reading", hum)
+	}
+	if pm := env.PM25Reading(); !pm.Valid || pm.Value != 12 || pm.ReceivedAt != received {
+		t.Errorf("got %+v", pm)
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr error
+	}{
+		{"0042", 42, nil},
+		{"0000", 0, nil},
+		{"", 0, ErrValueUnavailable},
+		{"OFF", 0, ErrValueUnavailable},
+		{"INIT", 0, ErrValueUnavailable},
+		{"NONE", 0, ErrValueUnavailable},
+	}
+	for _, test := range tests {
+		got, err := parseInt(test.raw)
+		if got != test.want || err != test.wantErr {
+			t.Errorf("parseInt(%q) = %d, %v, want %d, %v", test.raw, got, err, test.want, test.wantErr)
+		}
+	}
+	if _, err := parseInt("00x2"); err == nil || err == ErrValueUnavailable {
+		t.Errorf("parseInt(\"00x2\"): got %v, want a parse error", err)
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    bool
+		wantErr error
+	}{
+		{"ON", true, nil},
+		{"OFF", false, nil},
+		{"", false, ErrValueUnavailable},
+	}
+	for _, test := range tests {
+		got, err := parseBool(test.raw)
+		if got != test.want || err != test.wantErr {
+			t.Errorf("parseBool(%q) = %v, %v, want %v, %v", test.raw, got, err, test.want, test.wantErr)
+		}
+	}
+	if _, err := parseBool("MAYBE"); err == nil || err == ErrValueUnavailable {
+		t.Errorf("parseBool(\"MAYBE\"): got %v, want a parse error", err)
+	}
+}
+
+func TestTemperatureValue(t *testing.T) {
+	temp, err := (&EnvironmentState{Temperature: "2950"}).TemperatureValue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	near := func(a, b float64) bool { return a-b < 0.001 && b-a < 0.001 }
+	if !near(temp.Kelvin(), 295.0) || !near(temp.Celsius(), 21.85) || !near(temp.Fahrenheit(), 71.33) {
+		t.Errorf("got %vK %v°C %v°F, want 295K 21.85°C 71.33°F", temp.Kelvin(), temp.Celsius(), temp.Fahrenheit())
+	}
+	if temp.String() != "21.9°C" {
+		t.Errorf("got %q, want 21.9°C", temp.String())
+	}
+	if _, err := (&EnvironmentState{Temperature: "OFF"}).TemperatureValue(); err != ErrValueUnavailable {
+		t.Errorf("got %v, want ErrValueUnavailable", err)
+	}
+}
+
+func TestFanSpeedValue(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr error
+	}{
+		{FanModeAuto, 0, nil},
+		{"0001", 1, nil},
+		{"0010", 10, nil},
+		{"", 0, ErrValueUnavailable},
+	}
+	for _, test := range tests {
+		got, err := (&ProductState{FanSpeed: test.raw}).FanSpeedValue()
+		if got != test.want || err != test.wantErr {
+			t.Errorf("FanSpeedValue(%q) = %d, %v, want %d, %v", test.raw, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestFilterLifePercent(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    int
+		wantErr error
+	}{
+		{"4300", 100, nil},
+		{"2150", 50, nil},
+		{"0000", 0, nil},
+		{"5000", 100, nil},
+		{"INIT", 0, ErrValueUnavailable},
+	}
+	for _, test := range tests {
+		got, err := (&ProductState{FilterLife: test.raw}).FilterLifePercent()
+		if got != test.want || err != test.wantErr {
+			t.Errorf("FilterLifePercent(%q) = %d, %v, want %d, %v", test.raw, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestSleepTimerString(t *testing.T) {
+	tests := []struct {
+		minutes int
+		want    string
+		wantErr bool
+	}{
+		{0, SleepTimerOff, false},
+		{1, "0001", false},
+		{MaxSleepTimerMinutes, "0540", false},
+		{MaxSleepTimerMinutes + 1, "", true},
+		{-1, "", true},
+	}
+	for _, test := range tests {
+		got, err := SleepTimerString(test.minutes)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("SleepTimerString(%d) = %q, %v, want %q", test.minutes, got, err, test.want)
+		}
+	}
+}
+
+func TestHumidityTargetString(t *testing.T) {
+	tests := []struct {
+		percent int
+		want    string
+		wantErr bool
+	}{
+		{MinHumidityTarget, "0030", false},
+		{50, "0050", false},
+		{MaxHumidityTarget, "0070", false},
+		{MinHumidityTarget - 1, "", true},
+		{MaxHumidityTarget + 1, "", true},
+	}
+	for _, test := range tests {
+		got, err := HumidityTargetString(test.percent)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("HumidityTargetString(%d) = %q, %v, want %q", test.percent, got, err, test.want)
+		}
+	}
+}
+
+func TestOscillationAngleState(t *testing.T) {
+	tests := []struct {
+		lower, upper int
+		wantErr      bool
+	}{
+		{MinOscillationAngle, MaxOscillationAngle, false},
+		{45, 135, false},
+		{MinOscillationAngle - 1, 135, true},
+		{45, MaxOscillationAngle + 1, true},
+		{90, 90, true},
+		{135, 45, true},
+	}
+	for _, test := range tests {
+		state, err := OscillationAngleState(test.lower, test.upper)
+		if (err != nil) != test.wantErr {
+			t.Errorf("OscillationAngleState(%d, %d): got error %v", test.lower, test.upper, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if state.Oscillate != OscillateOn || state.AnglePreset != AnglePresetCustom {
+			t.Errorf("OscillationAngleState(%d, %d) = %+v", test.lower, test.upper, state)
+		}
+	}
+	state, _ := OscillationAngleState(45, 135)
+	if state.AngleLow != "0045" || state.AngleHigh != "0135" {
+		t.Errorf("got angles %q-%q, want 0045-0135", state.AngleLow, state.AngleHigh)
+	}
+}